@@ -0,0 +1,136 @@
+// Copyright 2023 Kirill Scherba <kirill@scherba.ru>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package teomutex
+
+import (
+	"math/rand"
+	"sync"
+	"time"
+)
+
+const (
+	// defaultBackoffBase and defaultBackoffCap are the default bounds used
+	// by Mutex and RWMutex to space out retries, see SetBackoff.
+	defaultBackoffBase = 1 * time.Millisecond
+	defaultBackoffCap  = 1 * time.Second
+)
+
+// backoff computes capped exponential backoff with full jitter, i.e.
+// sleep = rand(0, min(cap, base*2^attempt)), the scheme recommended by AWS
+// to stop many concurrent waiters from retrying in lockstep. attempt is
+// 0-based: the first retry uses attempt 0.
+type backoff struct {
+	base time.Duration
+	cap  time.Duration
+}
+
+// next returns the backoff to sleep before the given retry attempt
+// (0-based).
+func (b backoff) next(attempt int) time.Duration {
+	d := b.base
+	for i := 0; i < attempt && d < b.cap; i++ {
+		d *= 2
+		if d <= 0 { // overflowed
+			d = b.cap
+			break
+		}
+	}
+	if d > b.cap {
+		d = b.cap
+	}
+	if d <= 0 {
+		return 0
+	}
+	return time.Duration(rand.Int63n(int64(d)))
+}
+
+// dynamicTimeoutHeadroom is how many times the observed average successful
+// acquire latency the relaxed per-attempt timeout should allow for, so
+// normal latency variance doesn't itself trigger a timeout.
+const dynamicTimeoutHeadroom = 2
+
+// dynamicTimeoutSmoothing is the EWMA smoothing factor applied to both the
+// observed latency average and the timeout value derived from it: larger
+// values react to recent samples faster, smaller values are steadier.
+const dynamicTimeoutSmoothing = 0.2
+
+// dynamicTimeoutGrowth is the factor the effective timeout is multiplied by
+// every time an attempt times out, so a sequence of timeouts relaxes the
+// deadline quickly rather than waiting for enough successes to average it
+// up.
+const dynamicTimeoutGrowth = 1.5
+
+// DynamicTimeout tracks the observed latency of successful lock
+// acquisitions and reacts to timed-out attempts to adjust the effective
+// per-attempt deadline within [min, max] bounds. It keeps no count or rate
+// of timeouts: each timed-out attempt multiplies the deadline by
+// dynamicTimeoutGrowth. A bucket or region with higher natural
+// latency relaxes its timeout automatically instead of spuriously failing
+// every acquire attempt, while a fast one stays tight so a genuinely stuck
+// request is still caught quickly. See SetDynamicTimeout.
+type DynamicTimeout struct {
+	mu      sync.Mutex
+	min     time.Duration
+	max     time.Duration
+	timeout time.Duration // current effective per-attempt deadline
+	avg     time.Duration // EWMA of successful acquire latency
+}
+
+// NewDynamicTimeout returns a DynamicTimeout whose effective timeout is
+// always kept within [min, max], starting at max until enough successful
+// acquires have been observed to relax it.
+func NewDynamicTimeout(min, max time.Duration) *DynamicTimeout {
+	return &DynamicTimeout{min: min, max: max, timeout: max}
+}
+
+// Timeout returns the current effective per-attempt deadline.
+func (d *DynamicTimeout) Timeout() time.Duration {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.timeout
+}
+
+// LogSuccess records the latency of a successful lock acquisition, nudging
+// the effective timeout towards dynamicTimeoutHeadroom times the observed
+// average latency.
+func (d *DynamicTimeout) LogSuccess(latency time.Duration) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.avg == 0 {
+		d.avg = latency
+	} else {
+		d.avg = ewma(d.avg, latency, dynamicTimeoutSmoothing)
+	}
+
+	target := clampDuration(d.avg*dynamicTimeoutHeadroom, d.min, d.max)
+	d.timeout = clampDuration(ewma(d.timeout, target, dynamicTimeoutSmoothing), d.min, d.max)
+}
+
+// LogTimeout records that an attempt did not complete within the current
+// effective timeout, relaxing it towards max.
+func (d *DynamicTimeout) LogTimeout() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.timeout = clampDuration(time.Duration(float64(d.timeout)*dynamicTimeoutGrowth), d.min, d.max)
+}
+
+// ewma returns the exponentially weighted moving average of prev and
+// sample, weighting sample by alpha.
+func ewma(prev, sample time.Duration, alpha float64) time.Duration {
+	return time.Duration(alpha*float64(sample) + (1-alpha)*float64(prev))
+}
+
+// clampDuration restricts d to [min, max].
+func clampDuration(d, min, max time.Duration) time.Duration {
+	if d < min {
+		return min
+	}
+	if d > max {
+		return max
+	}
+	return d
+}
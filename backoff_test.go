@@ -0,0 +1,97 @@
+package teomutex
+
+import (
+	"testing"
+	"time"
+)
+
+func TestBackoffNext(t *testing.T) {
+	b := backoff{base: time.Millisecond, cap: 100 * time.Millisecond}
+
+	for attempt := 0; attempt < 10; attempt++ {
+		d := b.next(attempt)
+		if d < 0 || d > b.cap {
+			t.Fatalf("next(%d) = %s, want in [0, %s]", attempt, d, b.cap)
+		}
+	}
+
+	// Many attempts in should have saturated at the cap.
+	if d := b.next(64); d > b.cap {
+		t.Fatalf("next(64) = %s, want <= cap %s", d, b.cap)
+	}
+}
+
+func TestEwma(t *testing.T) {
+	got := ewma(100*time.Millisecond, 200*time.Millisecond, 0.5)
+	want := 150 * time.Millisecond
+	if got != want {
+		t.Errorf("ewma() = %s, want %s", got, want)
+	}
+
+	// alpha 0 ignores the new sample entirely.
+	if got := ewma(100*time.Millisecond, 200*time.Millisecond, 0); got != 100*time.Millisecond {
+		t.Errorf("ewma() with alpha 0 = %s, want unchanged 100ms", got)
+	}
+}
+
+func TestClampDuration(t *testing.T) {
+	min, max := 10*time.Millisecond, 100*time.Millisecond
+
+	if got := clampDuration(5*time.Millisecond, min, max); got != min {
+		t.Errorf("clampDuration(5ms) = %s, want min %s", got, min)
+	}
+	if got := clampDuration(200*time.Millisecond, min, max); got != max {
+		t.Errorf("clampDuration(200ms) = %s, want max %s", got, max)
+	}
+	if got := clampDuration(50*time.Millisecond, min, max); got != 50*time.Millisecond {
+		t.Errorf("clampDuration(50ms) = %s, want unchanged 50ms", got)
+	}
+}
+
+func TestDynamicTimeoutLogSuccess(t *testing.T) {
+	min, max := 10*time.Millisecond, time.Second
+	d := NewDynamicTimeout(min, max)
+
+	if got := d.Timeout(); got != max {
+		t.Fatalf("initial Timeout() = %s, want max %s", got, max)
+	}
+
+	// A string of fast successful acquires should relax the timeout well
+	// below the starting max.
+	for i := 0; i < 50; i++ {
+		d.LogSuccess(5 * time.Millisecond)
+	}
+	if got := d.Timeout(); got >= max {
+		t.Errorf("Timeout() after fast successes = %s, want < max %s", got, max)
+	}
+	if got := d.Timeout(); got < min {
+		t.Errorf("Timeout() after fast successes = %s, want >= min %s", got, min)
+	}
+}
+
+func TestDynamicTimeoutLogTimeout(t *testing.T) {
+	min, max := time.Millisecond, time.Second
+	d := NewDynamicTimeout(min, max)
+
+	// Relax the timeout down from max first.
+	for i := 0; i < 50; i++ {
+		d.LogSuccess(time.Microsecond)
+	}
+	relaxed := d.Timeout()
+	if relaxed >= max {
+		t.Fatalf("Timeout() after fast successes = %s, want < max %s", relaxed, max)
+	}
+
+	d.LogTimeout()
+	if got := d.Timeout(); got <= relaxed {
+		t.Errorf("Timeout() after LogTimeout = %s, want > pre-timeout value %s", got, relaxed)
+	}
+
+	// Repeated timeouts should eventually saturate at max.
+	for i := 0; i < 50; i++ {
+		d.LogTimeout()
+	}
+	if got := d.Timeout(); got != max {
+		t.Errorf("Timeout() after repeated timeouts = %s, want max %s", got, max)
+	}
+}
@@ -0,0 +1,67 @@
+// Copyright 2023 Kirill Scherba <kirill@scherba.ru>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package teomutex
+
+import (
+	"context"
+	"errors"
+)
+
+// LockStore is the storage backend behind a Mutex: it turns "create this
+// key only if it doesn't already exist" into a portable primitive so the
+// same Mutex/RWMutex logic can run against GCS, S3, Azure Blob, a local
+// filesystem (handy for tests that shouldn't need a live bucket), or any
+// other store that can do a conditional write.
+//
+// token identifies the version of the key a TryAcquire or Inspect observed
+// (a GCS object generation, an S3/Azure ETag, the random token the local
+// store keeps beside each file, ...); Release
+// uses it as a compare-and-delete precondition so a holder can never delete
+// a lock it no longer owns.
+type LockStore interface {
+	// TryAcquire creates key with the given payload only if key does not
+	// already exist, and returns the token of the object it created. It
+	// returns ErrAlreadyLocked if key already exists.
+	TryAcquire(ctx context.Context, key string, payload []byte) (token string, err error)
+
+	// Release deletes key, but only if its current token still matches
+	// token, i.e. nobody else has touched it since it was observed. It
+	// returns ErrTokenMismatch if the token no longer matches, and
+	// ErrNotFound if key does not exist.
+	Release(ctx context.Context, key string, token string) error
+
+	// Inspect returns the current payload and token of key. It returns
+	// ErrNotFound if key does not exist.
+	Inspect(ctx context.Context, key string) (payload []byte, token string, err error)
+}
+
+// LockRefresher is an optional extension of LockStore for backends that can
+// atomically overwrite a key conditioned on its current token (a
+// generation-match or If-Match style precondition). Mutex uses it to renew
+// a held lease in place; stores that don't implement it fall back to a
+// Release-then-TryAcquire pair, which briefly drops the lock and so should
+// only be used where that race is acceptable.
+type LockRefresher interface {
+	// Refresh overwrites key's payload, but only if its current token still
+	// matches token, and returns the token of the new version. It returns
+	// ErrTokenMismatch if the token no longer matches, and ErrNotFound if
+	// key does not exist.
+	Refresh(ctx context.Context, key string, token string, payload []byte) (newToken string, err error)
+}
+
+var (
+	// ErrAlreadyLocked is returned by LockStore.TryAcquire when key already
+	// exists.
+	ErrAlreadyLocked = errors.New("teomutex: lock already held")
+
+	// ErrTokenMismatch is returned by LockStore.Release and
+	// LockRefresher.Refresh when key was modified since its token was
+	// observed.
+	ErrTokenMismatch = errors.New("teomutex: lock token mismatch")
+
+	// ErrNotFound is returned by LockStore.Release and LockStore.Inspect
+	// when key does not exist.
+	ErrNotFound = errors.New("teomutex: lock not found")
+)
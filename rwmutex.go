@@ -0,0 +1,304 @@
+// Copyright 2023 Kirill Scherba <kirill@scherba.ru>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package teomutex
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"cloud.google.com/go/storage"
+	"github.com/google/uuid"
+)
+
+// RWMutex object structure and methods receiver. Unlike Mutex, which uses
+// the mere existence of the lock object to represent the lock, RWMutex
+// stores a small JSON document in the object payload describing who holds
+// it, so that any number of readers may hold the lock together as long as
+// no writer holds it. Like Mutex, it is backed by a LockStore, so it works
+// against any of the GCS, S3, Azure Blob or local filesystem backends.
+type RWMutex struct {
+	store   LockStore     // Lock storage backend
+	object  string        // Object (key) name
+	timeout time.Duration // Lock timeout
+	w       io.Writer     // Log writer
+	owner   string        // This holder's unique id, recorded among the readers while read-locked
+	backoff backoff       // Retry backoff, see SetBackoff
+}
+
+// rwState is the JSON document stored in the RWMutex lock object payload. A
+// writer holds the lock when Writer is true, in which case Readers is
+// always empty; any number of readers hold the lock when Writer is false
+// and their uuids are listed in Readers.
+type rwState struct {
+	Writer  bool     `json:"writer"`
+	Readers []string `json:"readers"`
+}
+
+// casAction tells casState what to do with the rwState an RLock/RUnlock/
+// Lock/Unlock attempt produced.
+type casAction int
+
+const (
+	casNoop   casAction = iota // state doesn't allow this attempt yet; retry later
+	casWrite                   // create or update the object to hold newState
+	casDelete                  // delete the object; newState is unused
+)
+
+// NewRWMutex creates new Teonet RWMutex object backed by Google Cloud
+// Storage.
+//
+// Parameters:
+//
+//	object - is the name of lock object
+//	backet - is the name of backet where lock objects created, by default used the "mutex" backet
+func NewRWMutex(object string, bucket ...string) (m *RWMutex, err error) {
+
+	// Set backet name
+	bucketName := defaultBucket
+	if len(bucket) > 0 {
+		bucketName = bucket[0]
+	}
+
+	// Creates storage client
+	ctx := context.Background()
+	client, err := storage.NewClient(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("creates storage client error: %s", err)
+	}
+
+	return NewRWMutexWithStore(NewGCSStore(client, bucketName), object)
+}
+
+// NewRWMutexWithStore creates new Teonet RWMutex object backed by store,
+// see NewMutexWithStore.
+func NewRWMutexWithStore(store LockStore, object string) (m *RWMutex, err error) {
+
+	// Creates new RWMutex object
+	m = new(RWMutex)
+
+	m.store = store
+	m.object = object
+
+	// Set log writer
+	m.w = os.NewFile(0, os.DevNull)
+
+	// Set default Lock timeout
+	m.timeout = defaultTimeout
+
+	// Set this holder's unique id
+	m.owner = uuid.NewString()
+
+	// Set default retry backoff
+	m.backoff = backoff{base: defaultBackoffBase, cap: defaultBackoffCap}
+
+	return
+}
+
+// Close the RWMutex object.
+func (m RWMutex) Close() error {
+	if closer, ok := m.store.(io.Closer); ok {
+		return closer.Close()
+	}
+	return nil
+}
+
+// SetLockTimeout sets lock timeout to avoid deadlock. The default timeout is
+// set to 10 seconds.
+func (m *RWMutex) SetLockTimeout(timeout time.Duration) {
+	m.timeout = timeout
+}
+
+// SetLogWriter sets log writer used in teomutex package functions.
+func (m *RWMutex) SetLogWriter(w io.Writer) {
+	m.w = w
+}
+
+// SetBackoff sets the bounds of the capped exponential backoff with full
+// jitter used to space out retries between failed lock attempts, see
+// Mutex.SetBackoff. The default is a 1ms base and a 1s cap.
+func (m *RWMutex) SetBackoff(base, cap time.Duration) {
+	m.backoff = backoff{base: base, cap: cap}
+}
+
+// RLock acquires a read lock, waiting for any current writer to release the
+// lock. Any number of readers may hold the lock at the same time.
+func (m RWMutex) RLock() error {
+	return m.retry(func() (bool, error) {
+		return m.casState(func(s rwState, exists bool) (rwState, casAction) {
+			if s.Writer {
+				return s, casNoop
+			}
+			s.Readers = append(s.Readers, m.owner)
+			return s, casWrite
+		})
+	}, "rlock timeout")
+}
+
+// RUnlock releases a read lock acquired by RLock.
+func (m RWMutex) RUnlock() error {
+	return m.retry(func() (bool, error) {
+		return m.casState(func(s rwState, exists bool) (rwState, casAction) {
+			if !exists {
+				return s, casNoop
+			}
+			readers := s.Readers[:0]
+			for _, owner := range s.Readers {
+				if owner != m.owner {
+					readers = append(readers, owner)
+				}
+			}
+			s.Readers = readers
+			if !s.Writer && len(s.Readers) == 0 {
+				return s, casDelete
+			}
+			return s, casWrite
+		})
+	}, "runlock timeout")
+}
+
+// Lock acquires a write lock, waiting for any current readers or writer to
+// release the lock. Only one writer may hold the lock at a time, and never
+// together with a reader.
+func (m RWMutex) Lock() error {
+	return m.retry(func() (bool, error) {
+		return m.casState(func(s rwState, exists bool) (rwState, casAction) {
+			if s.Writer || len(s.Readers) > 0 {
+				return s, casNoop
+			}
+			return rwState{Writer: true}, casWrite
+		})
+	}, "lock timeout")
+}
+
+// Unlock releases a write lock acquired by Lock.
+func (m RWMutex) Unlock() error {
+	return m.retry(func() (bool, error) {
+		return m.casState(func(s rwState, exists bool) (rwState, casAction) {
+			if !exists {
+				return s, casNoop
+			}
+			return rwState{}, casDelete
+		})
+	}, "unlock timeout")
+}
+
+// retry calls try repeatedly, backing off the same way Mutex.Lock does,
+// until it succeeds or the configured timeout elapses (in which case it
+// returns an error built from timeoutMsg). An error reported by try is
+// written to the log writer and the attempt is retried like any other.
+func (m RWMutex) retry(try func() (bool, error), timeoutMsg string) error {
+	start := time.Now()
+	for attempt := 0; ; attempt++ {
+		ok, err := try()
+		if err == nil && ok {
+			return nil
+		}
+		if err != nil {
+			fmt.Fprintf(m.w, "%s\n", err)
+		}
+		timeout := m.timeout - time.Since(start)
+		select {
+		case <-time.After(m.backoff.next(attempt)):
+			continue
+		case <-time.After(timeout):
+			return errors.New(timeoutMsg)
+		}
+	}
+}
+
+// casState reads the current rwState through the LockStore, applies update
+// to it, and writes the result back conditioned on the token it read, so
+// the update is a compare-and-swap: if the object changed since it was
+// read, the write is aborted and casState reports ok == false so the
+// caller retries. update reports what to do with the state it computed:
+// casNoop if the attempt can't proceed yet (e.g. a writer waiting for
+// readers to drain, or an unlock of a lock nobody holds), casWrite to
+// create or update the object, or casDelete to remove it (e.g. the last
+// reader or the writer releasing the lock).
+func (m RWMutex) casState(update func(s rwState, exists bool) (rwState, casAction)) (bool, error) {
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
+	defer cancel()
+
+	payload, token, err := m.store.Inspect(ctx, m.object)
+	exists := true
+	if errors.Is(err, ErrNotFound) {
+		exists, err = false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	var state rwState
+	if exists {
+		if err := json.Unmarshal(payload, &state); err != nil {
+			return false, fmt.Errorf("json.Unmarshal: %w", err)
+		}
+	}
+
+	newState, action := update(state, exists)
+
+	switch action {
+	case casNoop:
+		return false, nil
+
+	case casDelete:
+		if !exists {
+			return false, nil
+		}
+		if err := m.store.Release(ctx, m.object, token); err != nil {
+			if isCASRetryable(err) {
+				return false, nil
+			}
+			return false, err
+		}
+		return true, nil
+
+	case casWrite:
+		data, err := json.Marshal(newState)
+		if err != nil {
+			return false, fmt.Errorf("json.Marshal: %w", err)
+		}
+
+		if !exists {
+			if _, err := m.store.TryAcquire(ctx, m.object, data); err != nil {
+				if isCASRetryable(err) {
+					return false, nil
+				}
+				return false, err
+			}
+			return true, nil
+		}
+
+		refresher, ok := m.store.(LockRefresher)
+		if !ok {
+			return false, fmt.Errorf("store %T does not implement LockRefresher, required by RWMutex", m.store)
+		}
+		if _, err := refresher.Refresh(ctx, m.object, token, data); err != nil {
+			if isCASRetryable(err) {
+				return false, nil
+			}
+			return false, err
+		}
+		return true, nil
+
+	default:
+		return false, fmt.Errorf("unknown cas action %d", action)
+	}
+}
+
+// isCASRetryable reports whether err indicates another holder changed the
+// lock object between casState's read and write, in which case the caller
+// should simply retry against the new state rather than treat it as fatal.
+func isCASRetryable(err error) bool {
+	return errors.Is(err, ErrTokenMismatch) ||
+		errors.Is(err, ErrAlreadyLocked) ||
+		errors.Is(err, ErrNotFound)
+}
@@ -0,0 +1,148 @@
+package teomutex
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestLocalStoreRWMutexReaders(t *testing.T) {
+	store, err := NewLocalStore(filepath.Join(t.TempDir(), "locks"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r1, err := NewRWMutexWithStore(store, "test/rwlock/some_object")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r1.Close()
+	r1.SetLockTimeout(10 * time.Millisecond)
+
+	r2, err := NewRWMutexWithStore(store, "test/rwlock/some_object")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r2.Close()
+	r2.SetLockTimeout(10 * time.Millisecond)
+
+	// Two readers may hold the lock together.
+	if err := r1.RLock(); err != nil {
+		t.Fatal(err)
+	}
+	if err := r2.RLock(); err != nil {
+		t.Fatal(err)
+	}
+
+	// A writer must wait for both readers to drain.
+	w, err := NewRWMutexWithStore(store, "test/rwlock/some_object")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+	w.SetLockTimeout(10 * time.Millisecond)
+	if err := w.Lock(); err == nil {
+		t.Error("writer locked while readers still hold the lock")
+	}
+
+	if err := r1.RUnlock(); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Lock(); err == nil {
+		t.Error("writer locked while a reader still holds the lock")
+	}
+
+	if err := r2.RUnlock(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Last reader draining with no writer must remove the lock object
+	// entirely, not just leave it empty, so a stray RUnlock afterwards
+	// doesn't resurrect it.
+	if err := r2.RUnlock(); err == nil {
+		t.Error("RUnlock on a lock nobody holds should fail")
+	}
+
+	// With all readers gone, the writer may now acquire the lock.
+	if err := w.Lock(); err != nil {
+		t.Fatalf("writer should have acquired the lock: %s", err)
+	}
+	if err := w.Unlock(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestLocalStoreRWMutexWriter(t *testing.T) {
+	store, err := NewLocalStore(filepath.Join(t.TempDir(), "locks"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	w, err := NewRWMutexWithStore(store, "test/rwlock/some_object")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+	w.SetLockTimeout(10 * time.Millisecond)
+
+	if err := w.Lock(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Neither a second writer nor a reader may acquire the lock while it is
+	// write-locked.
+	other, err := NewRWMutexWithStore(store, "test/rwlock/some_object")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer other.Close()
+	other.SetLockTimeout(10 * time.Millisecond)
+
+	if err := other.Lock(); err == nil {
+		t.Error("second writer locked while the lock is write-held")
+	}
+	if err := other.RLock(); err == nil {
+		t.Error("reader locked while the lock is write-held")
+	}
+
+	if err := w.Unlock(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Once released, a reader can now acquire the lock.
+	if err := other.RLock(); err != nil {
+		t.Fatalf("reader should have acquired the lock: %s", err)
+	}
+	if err := other.RUnlock(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestLocalStoreRWMutexUnlockNotLocked(t *testing.T) {
+	store, err := NewLocalStore(filepath.Join(t.TempDir(), "locks"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	m, err := NewRWMutexWithStore(store, "test/rwlock/some_object")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer m.Close()
+	m.SetLockTimeout(10 * time.Millisecond)
+
+	// Unlock/RUnlock on a lock that was never acquired must fail rather
+	// than manufacture a lock object nobody holds.
+	if err := m.Unlock(); err == nil {
+		t.Error("Unlock on a lock nobody holds should fail")
+	}
+	if err := m.RUnlock(); err == nil {
+		t.Error("RUnlock on a lock nobody holds should fail")
+	}
+
+	// And must not have left a lock object behind: a writer should still
+	// be able to acquire the lock immediately.
+	if err := m.Lock(); err != nil {
+		t.Fatalf("lock should be free, got: %s", err)
+	}
+}
@@ -0,0 +1,113 @@
+// Copyright 2023 Kirill Scherba <kirill@scherba.ru>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package teomutex
+
+import (
+	"context"
+	"fmt"
+	"io"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/to"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/blob"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/bloberror"
+)
+
+// azureStore is the Azure Blob Storage LockStore. Unlike S3, Azure Blob
+// supports conditional writes on both upload (If-None-Match / If-Match)
+// and delete (If-Match), so TryAcquire, Refresh and Release are all true
+// compare-and-swap operations; a key's token is its ETag.
+type azureStore struct {
+	client    *azblob.Client
+	container string
+}
+
+// NewAzureStore returns a LockStore backed by container in client.
+func NewAzureStore(client *azblob.Client, container string) LockStore {
+	return &azureStore{client: client, container: container}
+}
+
+// TryAcquire implements LockStore.
+func (s *azureStore) TryAcquire(ctx context.Context, key string, payload []byte) (token string, err error) {
+	resp, err := s.client.UploadBuffer(ctx, s.container, key, payload, &azblob.UploadBufferOptions{
+		AccessConditions: &blob.AccessConditions{
+			ModifiedAccessConditions: &blob.ModifiedAccessConditions{
+				IfNoneMatch: to.Ptr(azcore.ETagAny),
+			},
+		},
+	})
+	if err != nil {
+		if bloberror.HasCode(err, bloberror.ConditionNotMet, bloberror.BlobAlreadyExists) {
+			return "", ErrAlreadyLocked
+		}
+		return "", fmt.Errorf("azblob.UploadBuffer: %w", err)
+	}
+
+	return string(*resp.ETag), nil
+}
+
+// Refresh implements LockRefresher.
+func (s *azureStore) Refresh(ctx context.Context, key string, token string, payload []byte) (newToken string, err error) {
+	resp, err := s.client.UploadBuffer(ctx, s.container, key, payload, &azblob.UploadBufferOptions{
+		AccessConditions: &blob.AccessConditions{
+			ModifiedAccessConditions: &blob.ModifiedAccessConditions{
+				IfMatch: to.Ptr(azcore.ETag(token)),
+			},
+		},
+	})
+	if err != nil {
+		if bloberror.HasCode(err, bloberror.ConditionNotMet) {
+			return "", ErrTokenMismatch
+		}
+		if bloberror.HasCode(err, bloberror.BlobNotFound) {
+			return "", ErrNotFound
+		}
+		return "", fmt.Errorf("azblob.UploadBuffer: %w", err)
+	}
+
+	return string(*resp.ETag), nil
+}
+
+// Release implements LockStore.
+func (s *azureStore) Release(ctx context.Context, key string, token string) error {
+	_, err := s.client.DeleteBlob(ctx, s.container, key, &azblob.DeleteBlobOptions{
+		AccessConditions: &blob.AccessConditions{
+			ModifiedAccessConditions: &blob.ModifiedAccessConditions{
+				IfMatch: to.Ptr(azcore.ETag(token)),
+			},
+		},
+	})
+	if err != nil {
+		if bloberror.HasCode(err, bloberror.ConditionNotMet) {
+			return ErrTokenMismatch
+		}
+		if bloberror.HasCode(err, bloberror.BlobNotFound) {
+			return ErrNotFound
+		}
+		return fmt.Errorf("azblob.DeleteBlob: %w", err)
+	}
+
+	return nil
+}
+
+// Inspect implements LockStore.
+func (s *azureStore) Inspect(ctx context.Context, key string) (payload []byte, token string, err error) {
+	resp, err := s.client.DownloadStream(ctx, s.container, key, nil)
+	if err != nil {
+		if bloberror.HasCode(err, bloberror.BlobNotFound) {
+			return nil, "", ErrNotFound
+		}
+		return nil, "", fmt.Errorf("azblob.DownloadStream: %w", err)
+	}
+	defer resp.Body.Close()
+
+	payload, err = io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, "", fmt.Errorf("io.ReadAll: %w", err)
+	}
+
+	return payload, string(*resp.ETag), nil
+}
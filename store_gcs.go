@@ -0,0 +1,150 @@
+// Copyright 2023 Kirill Scherba <kirill@scherba.ru>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package teomutex
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"cloud.google.com/go/storage"
+	"google.golang.org/api/googleapi"
+)
+
+// gcsStore is the Google Cloud Storage LockStore, and is the default store
+// used by NewMutex. A key's token is its object generation, formatted as a
+// decimal string.
+type gcsStore struct {
+	client *storage.Client
+	bucket string
+}
+
+// NewGCSStore returns a LockStore backed by bucket in client. NewMutex uses
+// this internally; call it directly to build a GCS-backed Mutex or RWMutex
+// from a *storage.Client you already have (e.g. one with custom options).
+func NewGCSStore(client *storage.Client, bucket string) LockStore {
+	return &gcsStore{client: client, bucket: bucket}
+}
+
+func (s *gcsStore) object(key string) *storage.ObjectHandle {
+	return s.client.Bucket(s.bucket).Object(key)
+}
+
+// TryAcquire implements LockStore.
+func (s *gcsStore) TryAcquire(ctx context.Context, key string, payload []byte) (token string, err error) {
+	ctx, cancel := context.WithTimeout(ctx, time.Second*50)
+	defer cancel()
+
+	o := s.object(key).If(storage.Conditions{DoesNotExist: true})
+	wc := o.NewWriter(ctx)
+	if _, err := io.Copy(wc, bytes.NewReader(payload)); err != nil {
+		return "", fmt.Errorf("io.Copy: %w", err)
+	}
+	if err := wc.Close(); err != nil {
+		if isPreconditionFailed(err) {
+			return "", ErrAlreadyLocked
+		}
+		return "", fmt.Errorf("writer.Close: %w", err)
+	}
+
+	return strconv.FormatInt(wc.Attrs().Generation, 10), nil
+}
+
+// Release implements LockStore.
+func (s *gcsStore) Release(ctx context.Context, key string, token string) error {
+	generation, err := strconv.ParseInt(token, 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid token %q: %w", token, err)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, time.Second*10)
+	defer cancel()
+
+	o := s.object(key).If(storage.Conditions{GenerationMatch: generation})
+	if err := o.Delete(ctx); err != nil {
+		if isPreconditionFailed(err) {
+			return ErrTokenMismatch
+		}
+		if errors.Is(err, storage.ErrObjectNotExist) {
+			return ErrNotFound
+		}
+		return fmt.Errorf("object(%q).Delete: %w", key, err)
+	}
+
+	return nil
+}
+
+// Refresh implements LockRefresher.
+func (s *gcsStore) Refresh(ctx context.Context, key string, token string, payload []byte) (newToken string, err error) {
+	generation, err := strconv.ParseInt(token, 10, 64)
+	if err != nil {
+		return "", fmt.Errorf("invalid token %q: %w", token, err)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, time.Second*10)
+	defer cancel()
+
+	o := s.object(key).If(storage.Conditions{GenerationMatch: generation})
+	wc := o.NewWriter(ctx)
+	if _, err := io.Copy(wc, bytes.NewReader(payload)); err != nil {
+		return "", fmt.Errorf("io.Copy: %w", err)
+	}
+	if err := wc.Close(); err != nil {
+		if isPreconditionFailed(err) {
+			return "", ErrTokenMismatch
+		}
+		if errors.Is(err, storage.ErrObjectNotExist) {
+			return "", ErrNotFound
+		}
+		return "", fmt.Errorf("writer.Close: %w", err)
+	}
+
+	return strconv.FormatInt(wc.Attrs().Generation, 10), nil
+}
+
+// Inspect implements LockStore.
+func (s *gcsStore) Inspect(ctx context.Context, key string) (payload []byte, token string, err error) {
+	ctx, cancel := context.WithTimeout(ctx, time.Second*10)
+	defer cancel()
+
+	o := s.object(key)
+	attrs, err := o.Attrs(ctx)
+	if errors.Is(err, storage.ErrObjectNotExist) {
+		return nil, "", ErrNotFound
+	}
+	if err != nil {
+		return nil, "", fmt.Errorf("object.Attrs: %w", err)
+	}
+
+	r, err := o.NewReader(ctx)
+	if err != nil {
+		return nil, "", fmt.Errorf("object.NewReader: %w", err)
+	}
+	defer r.Close()
+
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, "", fmt.Errorf("io.ReadAll: %w", err)
+	}
+
+	return data, strconv.FormatInt(attrs.Generation, 10), nil
+}
+
+// Close closes the underlying storage client.
+func (s *gcsStore) Close() error {
+	return s.client.Close()
+}
+
+// isPreconditionFailed reports whether err is the "precondition failed"
+// error GCS returns when the If(...) condition on a request does not hold.
+func isPreconditionFailed(err error) bool {
+	var gerr *googleapi.Error
+	return errors.As(err, &gerr) && gerr.Code == http.StatusPreconditionFailed
+}
@@ -0,0 +1,149 @@
+// Copyright 2023 Kirill Scherba <kirill@scherba.ru>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package teomutex
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	"github.com/google/uuid"
+)
+
+// localStore is a LockStore backed by the local filesystem. It has no
+// horizontal guarantees of its own (two processes on different machines
+// can't see each other's files), so it exists mainly so the rest of this
+// package can be unit-tested without a live cloud bucket; use NewLocalStore
+// wherever a throwaway, in-process LockStore is needed.
+//
+// A key's lock is a plain file holding its payload, plus a sidecar
+// "<file>.token" file holding a random token used as the compare-and-swap
+// precondition for Release and Refresh.
+type localStore struct {
+	dir string
+}
+
+// NewLocalStore returns a LockStore that stores lock objects as files under
+// dir, creating dir if it does not already exist.
+func NewLocalStore(dir string) (LockStore, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("os.MkdirAll: %w", err)
+	}
+	return &localStore{dir: dir}, nil
+}
+
+func (s *localStore) paths(key string) (object, token string) {
+	object = filepath.Join(s.dir, filepath.FromSlash(key))
+	return object, object + ".token"
+}
+
+// TryAcquire implements LockStore.
+func (s *localStore) TryAcquire(ctx context.Context, key string, payload []byte) (token string, err error) {
+	object, tokenPath := s.paths(key)
+
+	if err := os.MkdirAll(filepath.Dir(object), 0o755); err != nil {
+		return "", fmt.Errorf("os.MkdirAll: %w", err)
+	}
+
+	f, err := os.OpenFile(object, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o644)
+	if err != nil {
+		if errors.Is(err, fs.ErrExist) {
+			return "", ErrAlreadyLocked
+		}
+		return "", fmt.Errorf("os.OpenFile: %w", err)
+	}
+	defer f.Close()
+
+	if _, err := f.Write(payload); err != nil {
+		os.Remove(object)
+		return "", fmt.Errorf("file.Write: %w", err)
+	}
+
+	token = uuid.NewString()
+	if err := os.WriteFile(tokenPath, []byte(token), 0o644); err != nil {
+		os.Remove(object)
+		return "", fmt.Errorf("os.WriteFile: %w", err)
+	}
+
+	return token, nil
+}
+
+// Refresh implements LockRefresher.
+func (s *localStore) Refresh(ctx context.Context, key string, token string, payload []byte) (newToken string, err error) {
+	object, tokenPath := s.paths(key)
+
+	if err := s.checkToken(tokenPath, token); err != nil {
+		return "", err
+	}
+
+	if err := os.WriteFile(object, payload, 0o644); err != nil {
+		return "", fmt.Errorf("os.WriteFile: %w", err)
+	}
+
+	newToken = uuid.NewString()
+	if err := os.WriteFile(tokenPath, []byte(newToken), 0o644); err != nil {
+		return "", fmt.Errorf("os.WriteFile: %w", err)
+	}
+
+	return newToken, nil
+}
+
+// Release implements LockStore.
+func (s *localStore) Release(ctx context.Context, key string, token string) error {
+	object, tokenPath := s.paths(key)
+
+	if err := s.checkToken(tokenPath, token); err != nil {
+		return err
+	}
+
+	os.Remove(tokenPath)
+	if err := os.Remove(object); err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return ErrNotFound
+		}
+		return fmt.Errorf("os.Remove: %w", err)
+	}
+
+	return nil
+}
+
+// Inspect implements LockStore.
+func (s *localStore) Inspect(ctx context.Context, key string) (payload []byte, token string, err error) {
+	object, tokenPath := s.paths(key)
+
+	payload, err = os.ReadFile(object)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, "", ErrNotFound
+	}
+	if err != nil {
+		return nil, "", fmt.Errorf("os.ReadFile: %w", err)
+	}
+
+	tok, err := os.ReadFile(tokenPath)
+	if err != nil {
+		return nil, "", fmt.Errorf("os.ReadFile token: %w", err)
+	}
+
+	return payload, string(tok), nil
+}
+
+// checkToken verifies that the token recorded at tokenPath still matches
+// token, returning ErrNotFound or ErrTokenMismatch otherwise.
+func (s *localStore) checkToken(tokenPath, token string) error {
+	cur, err := os.ReadFile(tokenPath)
+	if errors.Is(err, fs.ErrNotExist) {
+		return ErrNotFound
+	}
+	if err != nil {
+		return fmt.Errorf("os.ReadFile token: %w", err)
+	}
+	if string(cur) != token {
+		return ErrTokenMismatch
+	}
+	return nil
+}
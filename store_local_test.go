@@ -0,0 +1,98 @@
+package teomutex
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestLocalStoreMutex(t *testing.T) {
+	store, err := NewLocalStore(filepath.Join(t.TempDir(), "locks"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	m, err := NewMutexWithStore(store, "test/lock/some_object")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer m.Close()
+	m.SetLockTimeout(10 * time.Millisecond)
+
+	if err := m.Lock(); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := m.Lock(); err == nil {
+		t.Error("lock error: locks already locked mutex without error")
+	}
+
+	if err := m.Unlock(); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := m.Unlock(); err == nil {
+		t.Error("unlock error: unlocks doesn't locked mutex without error")
+	}
+}
+
+func TestLocalStoreReclaimStaleLease(t *testing.T) {
+	store, err := NewLocalStore(filepath.Join(t.TempDir(), "locks"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	holder, err := NewMutexWithStore(store, "test/lock/some_object")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer holder.Close()
+	holder.SetLeaseDuration(time.Millisecond)
+
+	if err := holder.Lock(); err != nil {
+		t.Fatal(err)
+	}
+	// Simulate holder crashing: stop its lease refresh goroutine without
+	// releasing the lock, and wait for the lease to go stale.
+	holder.stopLeaseRefresh()
+	time.Sleep(leaseStaleFactor * time.Millisecond * 2)
+
+	waiter, err := NewMutexWithStore(store, "test/lock/some_object")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer waiter.Close()
+	waiter.SetLockTimeout(10 * time.Millisecond)
+
+	if err := waiter.Lock(); err != nil {
+		t.Fatalf("waiter should have reclaimed the stale lease: %s", err)
+	}
+}
+
+func TestLocalStoreFreshLeaseNotReclaimed(t *testing.T) {
+	store, err := NewLocalStore(filepath.Join(t.TempDir(), "locks"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	holder, err := NewMutexWithStore(store, "test/lock/some_object")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer holder.Close()
+
+	if err := holder.Lock(); err != nil {
+		t.Fatal(err)
+	}
+
+	waiter, err := NewMutexWithStore(store, "test/lock/some_object")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer waiter.Close()
+	waiter.SetLockTimeout(10 * time.Millisecond)
+
+	if err := waiter.Lock(); err == nil {
+		t.Error("waiter locked a mutex whose lease is still fresh")
+	}
+}
@@ -0,0 +1,150 @@
+// Copyright 2023 Kirill Scherba <kirill@scherba.ru>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package teomutex
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/aws/smithy-go"
+)
+
+// s3Store is the AWS S3 LockStore. It relies on S3's conditional writes
+// (If-None-Match / If-Match on PutObject) to implement TryAcquire and
+// Refresh; a key's token is its ETag. S3 has no conditional delete, so
+// Release checks the ETag with a HeadObject call before deleting, leaving a
+// short race between the two calls: the delete itself is unconditional, so
+// a lock that another holder created after the check is deleted as well.
+type s3Store struct {
+	client *s3.Client
+	bucket string
+}
+
+// NewS3Store returns a LockStore backed by bucket in client. It requires a
+// bucket with S3 conditional writes enabled (If-None-Match/If-Match support
+// on PutObject), generally available since August 2024.
+func NewS3Store(client *s3.Client, bucket string) LockStore {
+	return &s3Store{client: client, bucket: bucket}
+}
+
+// TryAcquire implements LockStore.
+func (s *s3Store) TryAcquire(ctx context.Context, key string, payload []byte) (token string, err error) {
+	_, err = s.client.PutObject(ctx, &s3.PutObjectInput{
+		Bucket:      aws.String(s.bucket),
+		Key:         aws.String(key),
+		Body:        bytes.NewReader(payload),
+		IfNoneMatch: aws.String("*"),
+	})
+	if err != nil {
+		if isS3PreconditionFailed(err) {
+			return "", ErrAlreadyLocked
+		}
+		return "", fmt.Errorf("s3.PutObject: %w", err)
+	}
+
+	return s.etag(ctx, key)
+}
+
+// Refresh implements LockRefresher.
+func (s *s3Store) Refresh(ctx context.Context, key string, token string, payload []byte) (newToken string, err error) {
+	_, err = s.client.PutObject(ctx, &s3.PutObjectInput{
+		Bucket:  aws.String(s.bucket),
+		Key:     aws.String(key),
+		Body:    bytes.NewReader(payload),
+		IfMatch: aws.String(token),
+	})
+	if err != nil {
+		if isS3PreconditionFailed(err) {
+			return "", ErrTokenMismatch
+		}
+		if isS3NotFound(err) {
+			return "", ErrNotFound
+		}
+		return "", fmt.Errorf("s3.PutObject: %w", err)
+	}
+
+	return s.etag(ctx, key)
+}
+
+// Release implements LockStore.
+func (s *s3Store) Release(ctx context.Context, key string, token string) error {
+	cur, err := s.etag(ctx, key)
+	if err != nil {
+		return err
+	}
+	if cur != token {
+		return ErrTokenMismatch
+	}
+
+	if _, err := s.client.DeleteObject(ctx, &s3.DeleteObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(key),
+	}); err != nil {
+		return fmt.Errorf("s3.DeleteObject: %w", err)
+	}
+
+	return nil
+}
+
+// Inspect implements LockStore.
+func (s *s3Store) Inspect(ctx context.Context, key string) (payload []byte, token string, err error) {
+	out, err := s.client.GetObject(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(key),
+	})
+	if isS3NotFound(err) {
+		return nil, "", ErrNotFound
+	}
+	if err != nil {
+		return nil, "", fmt.Errorf("s3.GetObject: %w", err)
+	}
+	defer out.Body.Close()
+
+	payload, err = io.ReadAll(out.Body)
+	if err != nil {
+		return nil, "", fmt.Errorf("io.ReadAll: %w", err)
+	}
+
+	return payload, aws.ToString(out.ETag), nil
+}
+
+// etag returns the current ETag of key.
+func (s *s3Store) etag(ctx context.Context, key string) (string, error) {
+	out, err := s.client.HeadObject(ctx, &s3.HeadObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(key),
+	})
+	if isS3NotFound(err) {
+		return "", ErrNotFound
+	}
+	if err != nil {
+		return "", fmt.Errorf("s3.HeadObject: %w", err)
+	}
+	return aws.ToString(out.ETag), nil
+}
+
+// isS3PreconditionFailed reports whether err is the error S3 returns when a
+// PutObject's If-None-Match/If-Match precondition does not hold.
+func isS3PreconditionFailed(err error) bool {
+	var apiErr smithy.APIError
+	return errors.As(err, &apiErr) && apiErr.ErrorCode() == "PreconditionFailed"
+}
+
+// isS3NotFound reports whether err is the error S3 returns for a missing
+// key.
+func isS3NotFound(err error) bool {
+	var nsk *types.NoSuchKey
+	if errors.As(err, &nsk) {
+		return true
+	}
+	var apiErr smithy.APIError
+	return errors.As(err, &apiErr) && (apiErr.ErrorCode() == "NoSuchKey" || apiErr.ErrorCode() == "NotFound")
+}
@@ -47,34 +47,81 @@
 	}
 */
 // ```
+//
+// teomutex is not tied to GCS: the lock itself is held through the
+// LockStore interface, and NewMutex is just a convenience constructor for
+// the GCS backend. Use NewMutexWithStore with any other LockStore (the
+// package also ships S3, Azure Blob and local filesystem backends) to run
+// teomutex elsewhere, or against a fake store in tests.
 package teomutex
 
 import (
-	"bytes"
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"os"
+	"sync"
 	"time"
 
 	"cloud.google.com/go/storage"
+	"github.com/google/uuid"
 )
 
 const (
 	defaultBucket  = "mutex"
 	defaultTimeout = 10 * time.Second
+
+	// defaultLeaseDuration is the lease a lock holder is granted before it
+	// must refresh; a holder that crashes leaves a lease that other waiters
+	// may reclaim once it goes stale, see leaseStaleFactor.
+	defaultLeaseDuration = 30 * time.Second
+
+	// refreshFactor sets how often the held lease is refreshed, as a
+	// fraction of leaseDuration (1/3 of the lease; with leaseStaleFactor 2,
+	// five refreshes in a row may be missed before the lease goes stale).
+	refreshFactor = 3
+
+	// leaseStaleFactor is how many leaseDuration periods must pass since the
+	// last refresh before a waiter is allowed to reclaim the lock.
+	leaseStaleFactor = 2
 )
 
 // Mutex object structure and methods receiver.
 type Mutex struct {
-	client  *storage.Client // Storage client
-	bucket  string          // Bucket name
-	object  string          // Object name
-	timeout time.Duration   // Lock timeout
-	w       io.Writer       // Log writer
+	store         LockStore       // Lock storage backend
+	object        string          // Object (key) name
+	timeout       time.Duration   // Lock timeout
+	w             io.Writer       // Log writer
+	owner         string          // This holder's unique id, used in the lease payload
+	leaseDuration time.Duration   // Lease duration, see SetLeaseDuration
+	lease         *leaseState     // State of the lease refresh goroutine, shared across copies of Mutex
+	backoff       backoff         // Retry backoff, see SetBackoff
+	dynTimeout    *DynamicTimeout // Per-attempt deadline, see SetDynamicTimeout; nil to disable
+}
+
+// leaseState holds the state of the background lease-refresh goroutine. It
+// is kept behind a pointer (rather than inlined into Mutex) so that Mutex
+// can keep being passed by value, as the rest of this package does, without
+// copying the sync.Mutex that guards it.
+type leaseState struct {
+	mu          sync.Mutex    // Protects the fields below
+	token       string        // Token of the object this Mutex currently holds the lock on
+	stopRefresh chan struct{} // Closed to stop the lease refresh goroutine
+	refreshDone chan struct{} // Closed by the lease refresh goroutine once it has stopped
 }
 
-// NewMutex creates new Teonet Mutex object.
+// leasePayload is the JSON document written as a lock object's payload; it
+// records who holds the lock and for how long, so a waiter can tell a live
+// holder from one that crashed without releasing the lock.
+type leasePayload struct {
+	Owner         string        `json:"owner"`
+	AcquiredAt    time.Time     `json:"acquired_at"`
+	LeaseDuration time.Duration `json:"lease_duration"`
+}
+
+// NewMutex creates new Teonet Mutex object backed by Google Cloud Storage.
 //
 // Parameters:
 //
@@ -82,37 +129,59 @@ type Mutex struct {
 //	backet - is the name of backet where lock objects created, by default used the "mutex" backet
 func NewMutex(object string, bucket ...string) (m *Mutex, err error) {
 
-	// Creates new Mutex object
-	m = new(Mutex)
-
-	// Set backet and object name
+	// Set backet name
+	bucketName := defaultBucket
 	if len(bucket) > 0 {
-		m.bucket = bucket[0]
-	} else {
-		m.bucket = defaultBucket
+		bucketName = bucket[0]
 	}
-	m.object = object
-
-	// Set log writer
-	m.w = os.NewFile(0, os.DevNull)
 
 	// Creates storage client
 	ctx := context.Background()
-	m.client, err = storage.NewClient(ctx)
+	client, err := storage.NewClient(ctx)
 	if err != nil {
-		err = fmt.Errorf("creates storage client error: %s", err)
-		return
+		return nil, fmt.Errorf("creates storage client error: %s", err)
 	}
 
+	return NewMutexWithStore(NewGCSStore(client, bucketName), object)
+}
+
+// NewMutexWithStore creates new Teonet Mutex object backed by store. Use
+// this to run teomutex against a backend other than the default GCS one
+// (the package also ships S3, Azure Blob and local filesystem stores), or
+// against a fake LockStore in tests.
+func NewMutexWithStore(store LockStore, object string) (m *Mutex, err error) {
+
+	// Creates new Mutex object
+	m = new(Mutex)
+
+	m.store = store
+	m.object = object
+
+	// Set log writer
+	m.w = os.NewFile(0, os.DevNull)
+
 	// Set default Lock timeout
 	m.timeout = defaultTimeout
 
+	// Set default lease duration and this holder's unique owner id
+	m.leaseDuration = defaultLeaseDuration
+	m.owner = uuid.NewString()
+	m.lease = new(leaseState)
+
+	// Set default retry backoff; dynamic per-attempt timeout stays disabled
+	// (m.dynTimeout == nil) until SetDynamicTimeout is called.
+	m.backoff = backoff{base: defaultBackoffBase, cap: defaultBackoffCap}
+
 	return
 }
 
 // Close the Mutex object.
 func (m Mutex) Close() error {
-	return m.client.Close()
+	m.stopLeaseRefresh()
+	if closer, ok := m.store.(io.Closer); ok {
+		return closer.Close()
+	}
+	return nil
 }
 
 // SetLockTimeout sets lock timeout to avoid deadlock. The default timeout is
@@ -126,20 +195,58 @@ func (m *Mutex) SetLogWriter(w io.Writer) {
 	m.w = w
 }
 
+// SetLeaseDuration sets the duration of the lease a held lock is granted
+// before it must be refreshed. The lock is refreshed roughly every
+// leaseDuration/3 while held, and is considered stale (and reclaimable by
+// another waiter) once 2*leaseDuration has passed since the last refresh.
+// The default lease duration is 30 seconds.
+func (m *Mutex) SetLeaseDuration(d time.Duration) {
+	m.leaseDuration = d
+}
+
+// SetBackoff sets the bounds of the capped exponential backoff with full
+// jitter used to space out retries between failed lock attempts: each
+// retry waits a random duration in [0, min(cap, base*2^attempt)]. The
+// jitter keeps many concurrent waiters from retrying in lockstep. The
+// default is a 1ms base and a 1s cap.
+func (m *Mutex) SetBackoff(base, cap time.Duration) {
+	m.backoff = backoff{base: base, cap: cap}
+}
+
+// SetDynamicTimeout enables a per-attempt deadline for the storage call
+// underlying each lock attempt that adapts to observed latency, instead of
+// the fixed deadlines the storage backend otherwise applies: it starts at
+// max and relaxes towards dynamicTimeoutHeadroom times the observed average
+// successful-acquire latency, growing again whenever an attempt times out,
+// always staying within [min, max]. This lets a bucket in a slow region
+// auto-relax while a fast one stays tight. Disabled by default.
+func (m *Mutex) SetDynamicTimeout(min, max time.Duration) {
+	m.dynTimeout = NewDynamicTimeout(min, max)
+}
+
 // Lock mutex
 func (m Mutex) Lock() error {
-	repeatAfter := 1 * time.Millisecond
+	return m.LockContext(context.Background())
+}
+
+// LockContext locks the mutex the same way Lock does, but aborts the
+// retry loop as soon as ctx is done (canceled or its deadline is exceeded)
+// in addition to the configured lock timeout. This lets callers tie a
+// pending lock acquisition to a client disconnect, request deadline or
+// shutdown signal.
+func (m Mutex) LockContext(ctx context.Context) error {
 	start := time.Now()
-	for {
-		if err := m.uploadObject(); err == nil {
+	for attempt := 0; ; attempt++ {
+		if err := m.acquire(ctx); err == nil {
 			return nil
 		} else {
 			fmt.Fprintf(m.w, "%s\n", err)
 		}
 		timeout := m.timeout - time.Since(start)
 		select {
-		case <-time.After(repeatAfter):
-			repeatAfter *= 2
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(m.backoff.next(attempt)):
 			continue
 		case <-time.After(timeout):
 			return fmt.Errorf("lock timeout")
@@ -149,72 +256,203 @@ func (m Mutex) Lock() error {
 
 // Unock mutex
 func (m Mutex) Unlock() error {
-	return m.deleteObject()
+	return m.UnlockContext(context.Background())
+}
+
+// UnlockContext unlocks the mutex the same way Unlock does, but derives
+// the storage RPC context from ctx so a cancellation aborts the in-flight
+// release call.
+func (m Mutex) UnlockContext(ctx context.Context) error {
+	m.stopLeaseRefresh()
+	return m.release(ctx)
+}
+
+// newLeasePayload builds the JSON payload recorded for the lease this
+// holder is acquiring or refreshing now.
+func (m Mutex) newLeasePayload() ([]byte, error) {
+	payload, err := json.Marshal(leasePayload{
+		Owner:         m.owner,
+		AcquiredAt:    time.Now().UTC(),
+		LeaseDuration: m.leaseDuration,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("json.Marshal: %w", err)
+	}
+	return payload, nil
 }
 
-// uploadObject uploads mutex object.
-func (m Mutex) uploadObject() error {
+// acquire tries to create the lock object, recording a lease (owner,
+// acquired-at, lease-duration) in its payload. If the object already exists
+// but its lease has gone stale, the stale object is reclaimed and the
+// create is retried once before giving up.
+func (m Mutex) acquire(ctx context.Context) error {
 
 	// Print start message
 	fmt.Fprintf(m.w, "Uploading object %s started...\n", m.object)
 
-	// Create bytes reader to upload
-	r := bytes.NewReader([]byte("locked"))
-
-	o := m.client.Bucket(m.bucket).Object(m.object)
-
-	// Optional: set a generation-match precondition to avoid potential race
-	// conditions and data corruptions. The request to upload is aborted if the
-	// object's generation number does not match your precondition.
-	// For an object that does not yet exist, set the DoesNotExist precondition.
-	o = o.If(storage.Conditions{DoesNotExist: true})
-	// If the live object already exists in your bucket, set instead a
-	// generation-match precondition using the live object's generation number.
-	// attrs, err := o.Attrs(ctx)
-	// if err != nil {
-	//      return fmt.Errorf("object.Attrs: %w", err)
-	// }
-	// o = o.If(storage.Conditions{GenerationMatch: attrs.Generation})
-
-	ctx, cancel := context.WithTimeout(context.Background(), time.Second*50)
-	defer cancel()
+	payload, err := m.newLeasePayload()
+	if err != nil {
+		return err
+	}
 
-	// Upload an object with bytes.Reader
-	wc := o.NewWriter(ctx)
-	if _, err := io.Copy(wc, r); err != nil {
-		return fmt.Errorf("io.Copy: %w", err)
+	attemptCtx := ctx
+	if m.dynTimeout != nil {
+		var cancel context.CancelFunc
+		attemptCtx, cancel = context.WithTimeout(ctx, m.dynTimeout.Timeout())
+		defer cancel()
+	}
+
+	attemptStart := time.Now()
+	token, err := m.store.TryAcquire(attemptCtx, m.object, payload)
+	if errors.Is(err, ErrAlreadyLocked) {
+		if m.reclaimStaleLease(ctx) {
+			token, err = m.store.TryAcquire(attemptCtx, m.object, payload)
+		}
 	}
-	if err := wc.Close(); err != nil {
-		return fmt.Errorf("writer.Close: %w", err)
+	if m.dynTimeout != nil {
+		if errors.Is(err, context.DeadlineExceeded) {
+			m.dynTimeout.LogTimeout()
+		} else if err == nil {
+			m.dynTimeout.LogSuccess(time.Since(attemptStart))
+		}
+	}
+	if err != nil {
+		return err
 	}
 
+	m.lease.mu.Lock()
+	m.lease.token = token
+	m.lease.mu.Unlock()
+	m.startLeaseRefresh()
+
 	// Print success result message
 	fmt.Fprintf(m.w, "Blob %s uploaded.\n", m.object)
 	return nil
 }
 
-// deleteObject deletess mutex object.
-func (m Mutex) deleteObject() error {
+// reclaimStaleLease checks the lock object's current lease and, if it has
+// not been refreshed for more than 2*lease-duration, releases it so the
+// caller may retry acquiring the lock. It reports whether the object was
+// reclaimed.
+func (m Mutex) reclaimStaleLease(ctx context.Context) bool {
 
-	// Print start message
-	fmt.Fprintf(m.w, "Deleting object %s started...\n", m.object)
+	payload, token, err := m.store.Inspect(ctx, m.object)
+	if err != nil {
+		fmt.Fprintf(m.w, "reclaim: inspect: %s\n", err)
+		return false
+	}
+
+	var lease leasePayload
+	if err := json.Unmarshal(payload, &lease); err != nil {
+		fmt.Fprintf(m.w, "reclaim: invalid lease payload: %s\n", err)
+		return false
+	}
+
+	if time.Since(lease.AcquiredAt) <= leaseStaleFactor*lease.LeaseDuration {
+		return false
+	}
+
+	if err := m.store.Release(ctx, m.object, token); err != nil {
+		fmt.Fprintf(m.w, "reclaim: release: %s\n", err)
+		return false
+	}
+
+	fmt.Fprintf(m.w, "Blob %s reclaimed from owner %s, stale since %s.\n",
+		m.object, lease.Owner, lease.AcquiredAt)
+	return true
+}
+
+// startLeaseRefresh starts the background goroutine that periodically
+// rewrites the held lock object's lease payload to keep it from going
+// stale while this Mutex holds it.
+func (m Mutex) startLeaseRefresh() {
+	m.lease.mu.Lock()
+	defer m.lease.mu.Unlock()
+
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	m.lease.stopRefresh = stop
+	m.lease.refreshDone = done
+
+	go func() {
+		defer close(done)
+		ticker := time.NewTicker(m.leaseDuration / refreshFactor)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+				m.refreshLease()
+			}
+		}
+	}()
+}
+
+// refreshLease rewrites the lease payload of the object this Mutex
+// currently holds, bumping its acquired-at time, conditioned on the token
+// last observed so a lock lost to reclamation is not resurrected. Stores
+// that don't implement LockRefresher fall back to a release-then-reacquire
+// pair, which briefly drops the lock.
+func (m Mutex) refreshLease() {
+	m.lease.mu.Lock()
+	token := m.lease.token
+	m.lease.mu.Unlock()
 
 	ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
 	defer cancel()
 
-	o := m.client.Bucket(m.bucket).Object(m.object)
+	payload, err := m.newLeasePayload()
+	if err != nil {
+		fmt.Fprintf(m.w, "refresh lease: %s\n", err)
+		return
+	}
 
-	// Optional: set a generation-match precondition to avoid potential race
-	// conditions and data corruptions. The request to delete the file is aborted
-	// if the object's generation number does not match your precondition.
-	attrs, err := o.Attrs(ctx)
+	var newToken string
+	if refresher, ok := m.store.(LockRefresher); ok {
+		newToken, err = refresher.Refresh(ctx, m.object, token, payload)
+	} else {
+		if err = m.store.Release(ctx, m.object, token); err == nil {
+			newToken, err = m.store.TryAcquire(ctx, m.object, payload)
+		}
+	}
 	if err != nil {
-		return fmt.Errorf("object.Attrs: %w", err)
+		fmt.Fprintf(m.w, "refresh lease: %s\n", err)
+		return
+	}
+
+	m.lease.mu.Lock()
+	m.lease.token = newToken
+	m.lease.mu.Unlock()
+}
+
+// stopLeaseRefresh stops the lease refresh goroutine started by
+// startLeaseRefresh, if one is running.
+func (m Mutex) stopLeaseRefresh() {
+	m.lease.mu.Lock()
+	stop, done := m.lease.stopRefresh, m.lease.refreshDone
+	m.lease.stopRefresh, m.lease.refreshDone = nil, nil
+	m.lease.mu.Unlock()
+
+	if stop == nil {
+		return
 	}
-	o = o.If(storage.Conditions{GenerationMatch: attrs.Generation})
+	close(stop)
+	<-done
+}
+
+// release deletes the lock object this Mutex holds.
+func (m Mutex) release(ctx context.Context) error {
+
+	// Print start message
+	fmt.Fprintf(m.w, "Deleting object %s started...\n", m.object)
+
+	m.lease.mu.Lock()
+	token := m.lease.token
+	m.lease.mu.Unlock()
 
-	if err := o.Delete(ctx); err != nil {
-		return fmt.Errorf("object(%q).Delete: %w", m.object, err)
+	if err := m.store.Release(ctx, m.object, token); err != nil {
+		return fmt.Errorf("release %q: %w", m.object, err)
 	}
 
 	// Print success result message